@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/altcha-org/altcha-lib-go"
+	"github.com/dgraph-io/ristretto/v2"
+)
+
+// legacyCaptchaAPIEnabled gates the RuCaptcha/AntiGate-compatible subrouter.
+// It's opt-in: most deployments should talk to ALTCHA's own /challenge and
+// /verify endpoints directly.
+var legacyCaptchaAPIEnabled = getEnvAsBool("LEGACY_CAPTCHA_API", false)
+
+// legacyCaptchaEntry tracks one in.php-issued captcha id through to its
+// solved ALTCHA payload, so res.php can poll for it the way RuCaptcha/
+// AntiGate clients expect. ristretto hands the same *legacyCaptchaEntry back
+// to every Get, and clients are expected to poll action=get repeatedly, so
+// verified/solution are guarded by mu against concurrent polls for the same
+// id.
+type legacyCaptchaEntry struct {
+	challenge altcha.Challenge
+	expiresAt time.Time
+
+	mu       sync.Mutex
+	solution string
+	verified bool
+}
+
+var legacyCaptchas *ristretto.Cache[string, *legacyCaptchaEntry]
+
+// initLegacyCaptchaStore sets up the cache backing the legacy subrouter. It
+// is separate from usedSolutions because it stores pending challenges, not
+// solved-payload replay markers.
+func initLegacyCaptchaStore() error {
+	cache, err := ristretto.NewCache(&ristretto.Config[string, *legacyCaptchaEntry]{
+		NumCounters: 1e6,
+		MaxCost:     1 << 30,
+		BufferItems: 64,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize legacy captcha cache: %w", err)
+	}
+	legacyCaptchas = cache
+	return nil
+}
+
+// inPhpHandler emulates the classic RuCaptcha/AntiGate v2 "in.php" endpoint:
+// instead of queueing an image for a human worker, it issues a fresh ALTCHA
+// challenge and hands back an id the client polls via res.php.
+//
+// The real RuCaptcha/AntiGate protocol has no equivalent step for handing the
+// client a puzzle to solve (a human just looks at the image), so in JSON
+// mode we additionally return the challenge fields under "challenge": a
+// caller has nothing else to compute an altcha= proof-of-work solution from
+// before submitting it back to res.php?action=get.
+func inPhpHandler(w http.ResponseWriter, r *http.Request) {
+	jsonMode := r.FormValue("json") == "1"
+
+	expiresAt := time.Now().Add(time.Duration(expireTimeInMins) * time.Minute)
+	challenge, err := altcha.CreateChallenge(altcha.ChallengeOptions{
+		HMACKey:   altchaHMACKey,
+		MaxNumber: 50000,
+		Expires:   &expiresAt,
+	})
+	if err != nil {
+		logger.Error("legacy in.php failed to create challenge", "error", err)
+		writeLegacyError(w, jsonMode, "ERROR_CAPTCHA_UNSOLVABLE")
+		return
+	}
+
+	id := newRequestID()
+	legacyCaptchas.SetWithTTL(id, &legacyCaptchaEntry{
+		challenge: challenge,
+		expiresAt: expiresAt,
+	}, int64(1), time.Until(expiresAt))
+
+	if jsonMode {
+		writeJSON(w, map[string]interface{}{"status": 1, "request": id, "challenge": challenge})
+		return
+	}
+	fmt.Fprintf(w, "OK|%s", id)
+}
+
+// resPhpHandler emulates "res.php": action=get polls for the ALTCHA payload
+// previously solved and submitted by the client for id, and
+// action=reportbad invalidates a pending or solved id.
+func resPhpHandler(w http.ResponseWriter, r *http.Request) {
+	jsonMode := r.FormValue("json") == "1"
+	id := r.FormValue("id")
+
+	entry, found := legacyCaptchas.Get(id)
+	if !found {
+		writeLegacyError(w, jsonMode, "ERROR_WRONG_CAPTCHA_ID")
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "reportbad":
+		legacyCaptchas.Del(id)
+		writeLegacyOK(w, jsonMode, "OK_REPORT_RECORDED")
+
+	case "get":
+		entry.mu.Lock()
+		verified, solution := entry.verified, entry.solution
+		if !verified {
+			if candidate := r.FormValue("altcha"); candidate != "" {
+				ok, err := altcha.VerifySolution(candidate, altchaHMACKey, true)
+				if err != nil {
+					logger.Error("legacy res.php verification error", "error", err)
+				} else if ok {
+					entry.verified = true
+					entry.solution = candidate
+					verified, solution = true, candidate
+				}
+			}
+		}
+		entry.mu.Unlock()
+
+		if !verified {
+			writeLegacyStatus(w, jsonMode, "CAPCHA_NOT_READY")
+			return
+		}
+		writeLegacyOK(w, jsonMode, solution)
+
+	default:
+		writeLegacyError(w, jsonMode, "ERROR_WRONG_ACTION")
+	}
+}
+
+func writeLegacyOK(w http.ResponseWriter, jsonMode bool, request string) {
+	if jsonMode {
+		writeJSON(w, map[string]interface{}{"status": 1, "request": request})
+		return
+	}
+	fmt.Fprintf(w, "OK|%s", request)
+}
+
+func writeLegacyError(w http.ResponseWriter, jsonMode bool, code string) {
+	writeLegacyStatus(w, jsonMode, code)
+}
+
+func writeLegacyStatus(w http.ResponseWriter, jsonMode bool, code string) {
+	if jsonMode {
+		writeJSON(w, map[string]interface{}{"status": 0, "request": code})
+		return
+	}
+	fmt.Fprint(w, code)
+}
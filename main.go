@@ -4,17 +4,15 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"os"
 	"runtime"
 	"strconv"
-	"sync/atomic"
 	"time"
 
 	"github.com/altcha-org/altcha-lib-go"
-	"github.com/dgraph-io/ristretto/v2"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
@@ -23,6 +21,9 @@ var (
 	expireTimeInMins       = getEnvAsInt("EXPIRE_TIME_IN_MINS", 5)
 	replayDetectionEnabled = getEnvAsBool("ENABLE_REPLAY_DETECTION", false)
 	allowedOrigins         = getEnv("ALLOWED_ORIGINS", "*")
+	challengeRPS           = getEnvAsFloat("CHALLENGE_RPS", 5)
+	verifyRPS              = getEnvAsFloat("VERIFY_RPS", 5)
+	rateLimitBurst         = getEnvAsInt("BURST", 10)
 )
 
 type healthPayload struct {
@@ -36,41 +37,60 @@ type healthPayload struct {
 }
 
 var startTime = time.Now()
-var cacheCount int64 = 0
 
-var usedSolutions *ristretto.Cache[string, time.Time]
+var usedSolutions ReplayStore
 
 func main() {
+	initLogger()
+
 	if replayDetectionEnabled {
 		var err error
-		usedSolutions, err = ristretto.NewCache(&ristretto.Config[string, time.Time]{
-			NumCounters: 1e6,     // number of keys to track frequency of (1M)
-			MaxCost:     1 << 30, // maximum cost of cache (1GB)
-			BufferItems: 64,      // number of keys per Get buffer
-			// Print a message when a value is evicted
-			OnEvict: func(item *ristretto.Item[time.Time]) {
-				atomic.AddInt64(&cacheCount, -1)
-				log.Printf("Evicted from cache: %v", item.Key)
-			},
-		})
+		usedSolutions, err = newReplayStore()
 		if err != nil {
-			log.Fatalf("Failed to initialize Ristretto cache: %v", err)
+			logger.Error("failed to initialize replay store", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if legacyCaptchaAPIEnabled {
+		if err := initLegacyCaptchaStore(); err != nil {
+			logger.Error("failed to initialize legacy captcha API", "error", err)
+			os.Exit(1)
 		}
 	}
 
+	challengeLimiter := newIPRateLimiter(challengeRPS, rateLimitBurst, 10*time.Minute)
+	verifyLimiter := newIPRateLimiter(verifyRPS, rateLimitBurst, 10*time.Minute)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", healthHandler)
-	mux.HandleFunc("/challenge", challengeHandler)
-	mux.HandleFunc("/verify", verifyHandler)
+	mux.Handle("/challenge", rateLimitMiddleware(challengeLimiter, http.HandlerFunc(challengeHandler)))
+	mux.Handle("/verify", rateLimitMiddleware(verifyLimiter, http.HandlerFunc(verifyHandler)))
+	mux.Handle("/verify-spam-filter", rateLimitMiddleware(verifyLimiter, http.HandlerFunc(verifySpamFilterHandler)))
+	mux.Handle("/metrics", promhttp.Handler())
+	if legacyCaptchaAPIEnabled {
+		logger.Info("legacy RuCaptcha/AntiGate-compatible API enabled at /in.php and /res.php")
+		mux.Handle("/in.php", rateLimitMiddleware(challengeLimiter, http.HandlerFunc(inPhpHandler)))
+		mux.Handle("/res.php", rateLimitMiddleware(verifyLimiter, http.HandlerFunc(resPhpHandler)))
+	}
 
-	log.Printf("ALTCHA server is up and running on port %s\n", serverPort)
 	if !replayDetectionEnabled {
-		log.Printf("WARNING: replay detection has been disabled! You can enable it using setting ENABLE_REPLAY_DETECTION=true\n")
-	}
-	handler := loggingMiddleware(corsMiddleware(mux))
-	if err := http.ListenAndServe(":"+serverPort, handler); err != nil {
-		log.Fatal(err)
+		logger.Warn("replay detection is disabled; enable it with ENABLE_REPLAY_DETECTION=true")
 	}
+
+	handler := requestIDMiddleware(loggingMiddleware(corsMiddleware(mux)))
+	srv := newHTTPServer(handler)
+
+	go func() {
+		logger.Info("ALTCHA server starting", "port", serverPort)
+		if err := serve(srv); err != nil && err != http.ErrServerClosed {
+			logger.Error("server error", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	waitForShutdown(srv)
+	logger.Info("ALTCHA server stopped")
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -85,7 +105,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		MemAllocMB:             m.Alloc / 1024 / 1024, // Convert bytes to MB
 		MemSysMB:               m.Sys / 1024 / 1024,   // Convert bytes to MB
 		NumGoroutine:           runtime.NumGoroutine(),
-		Cache:                  atomic.LoadInt64(&cacheCount),
+		Cache:                  replayStoreLen(),
 		ReplayDetectionEnabled: replayDetectionEnabled,
 	}
 
@@ -105,10 +125,13 @@ func challengeHandler(w http.ResponseWriter, r *http.Request) {
 		Expires:   &expiresAt,
 	})
 	if err != nil {
+		logger.Error("failed to create challenge", "requestId", requestIDFromContext(r.Context()), "error", err)
 		http.Error(w, fmt.Sprintf("Failed to create challenge: %s", err), http.StatusInternalServerError)
 		return
 	}
 
+	challengesIssuedTotal.Inc()
+	logger.Info("challenge issued", "requestId", requestIDFromContext(r.Context()))
 	writeJSON(w, challenge)
 }
 
@@ -124,22 +147,30 @@ func verifyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	requestID := requestIDFromContext(r.Context())
+
 	if replayDetectionEnabled && usedSolutions != nil {
-		if expiresAt, found := usedSolutions.Get(payload); found {
+		if expiresAt, found := usedSolutions.Seen(payload); found {
 			if time.Now().Before(expiresAt) {
+				verificationsTotal.WithLabelValues("replay").Inc()
+				logger.Warn("altcha verification rejected", "requestId", requestID, "outcome", "replay", "replayHit", true)
 				writeError(w, "Replay detected: CAPTCHA already used")
 				return
 			}
 		}
 	}
 
+	verifyStart := time.Now()
 	verified, err := altcha.VerifySolution(payload, altchaHMACKey, true)
+	verificationDurationSeconds.Observe(time.Since(verifyStart).Seconds())
 	if err != nil || !verified {
 		if err != nil {
-			log.Printf("Altcha verification error: %v", err)
+			verificationsTotal.WithLabelValues("error").Inc()
+			logger.Error("altcha verification error", "requestId", requestID, "outcome", "error", "error", err)
 			writeError(w, "Verification error: "+err.Error())
 		} else {
-			log.Println("Altcha verification failed: token is invalid or expired")
+			verificationsTotal.WithLabelValues("invalid").Inc()
+			logger.Warn("altcha verification failed", "requestId", requestID, "outcome", "invalid")
 			writeError(w, "Invalid or expired Altcha token")
 		}
 		return
@@ -147,14 +178,25 @@ func verifyHandler(w http.ResponseWriter, r *http.Request) {
 
 	if replayDetectionEnabled && usedSolutions != nil {
 		expiresAt := time.Now().Add(time.Duration(expireTimeInMins) * time.Minute)
-		// SetWithTTL(key, value, cost, ttl). cost is an int64
-		usedSolutions.SetWithTTL(payload, expiresAt, int64(1), time.Duration(expireTimeInMins)*time.Minute)
-		atomic.AddInt64(&cacheCount, 1)
+		if err := usedSolutions.Record(payload, expiresAt); err != nil {
+			logger.Error("failed to record solution in replay store", "requestId", requestID, "error", err)
+		}
 	}
 
+	verificationsTotal.WithLabelValues("success").Inc()
+	logger.Info("altcha verification succeeded", "requestId", requestID, "outcome", "success")
 	writeJSON(w, map[string]bool{"success": true})
 }
 
+// replayStoreLen reports the current replay store size, or 0 when replay
+// detection is disabled.
+func replayStoreLen() int64 {
+	if !replayDetectionEnabled || usedSolutions == nil {
+		return 0
+	}
+	return usedSolutions.Len()
+}
+
 // Utility functions
 func getEnv(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
@@ -172,6 +214,15 @@ func getEnvAsInt(key string, fallback int) int {
 	return val
 }
 
+func getEnvAsFloat(key string, fallback float64) float64 {
+	valStr := getEnv(key, "")
+	val, err := strconv.ParseFloat(valStr, 64)
+	if err != nil {
+		return fallback
+	}
+	return val
+}
+
 func getEnvAsBool(key string, fallback bool) bool {
 	valStr := getEnv(key, "")
 	val, err := strconv.ParseBool(valStr)
@@ -197,14 +248,16 @@ func corsMiddleware(next http.Handler) http.Handler {
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		// Proceed with request
-		next.ServeHTTP(w, r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
 		duration := time.Since(start)
-		log.Printf("%s %s from %s - %v",
-			r.Method,
-			r.URL.Path,
-			getRealIP(r),
-			duration,
+		logger.Info("http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"durationMs", duration.Milliseconds(),
+			"remoteIp", getRealIP(r),
+			"requestId", requestIDFromContext(r.Context()),
 		)
 	})
 }
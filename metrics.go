@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	challengesIssuedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "altcha_challenges_issued_total",
+		Help: "Total number of ALTCHA challenges issued.",
+	})
+
+	// verificationsTotal is labeled "invalid" for both invalid and expired
+	// tokens, since altcha-lib-go's VerifySolution doesn't currently
+	// distinguish the two outcomes.
+	verificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "altcha_verifications_total",
+		Help: "Total number of ALTCHA verifications, labeled by outcome (success, invalid, error, replay).",
+	}, []string{"outcome"})
+
+	verificationDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "altcha_verification_duration_seconds",
+		Help:    "Time spent verifying an ALTCHA solution.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	replayCacheEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "altcha_replay_cache_evictions_total",
+		Help: "Total number of entries evicted from the in-memory replay cache.",
+	})
+
+	// replayStoreErrorsTotal counts replay-store backend failures (e.g. Redis
+	// connection errors or timeouts), distinct from a legitimate "not seen"
+	// result, so an operator can tell a real outage from normal traffic.
+	replayStoreErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "altcha_replay_store_errors_total",
+		Help: "Total number of replay-store backend errors, labeled by operation (seen, record).",
+	}, []string{"operation"})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "altcha_replay_cache_size",
+		Help: "Current number of entries tracked by the replay store.",
+	}, func() float64 {
+		return float64(replayStoreLen())
+	})
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "altcha_uptime_seconds",
+		Help: "Seconds since the server started.",
+	}, func() float64 {
+		return time.Since(startTime).Seconds()
+	})
+}
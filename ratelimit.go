@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ipRateLimiter hands out a golang.org/x/time/rate limiter per client IP so
+// a single attacker can't hammer an endpoint into exhausting server-side
+// work (PoW generation) or cache space, while legitimate clients on other
+// IPs are unaffected. Idle buckets are swept after idleTTL so memory usage
+// tracks active clients rather than every IP that's ever connected.
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rateLimiterEntry
+	rps      rate.Limit
+	burst    int
+	idleTTL  time.Duration
+}
+
+type rateLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newIPRateLimiter(rps float64, burst int, idleTTL time.Duration) *ipRateLimiter {
+	l := &ipRateLimiter{
+		limiters: make(map[string]*rateLimiterEntry),
+		rps:      rate.Limit(rps),
+		burst:    burst,
+		idleTTL:  idleTTL,
+	}
+	go l.evictIdleLoop()
+	return l
+}
+
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	entry, ok := l.limiters[ip]
+	if !ok {
+		entry = &rateLimiterEntry{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.limiters[ip] = entry
+	}
+	entry.lastSeen = time.Now()
+	l.mu.Unlock()
+
+	return entry.limiter.Allow()
+}
+
+func (l *ipRateLimiter) evictIdleLoop() {
+	ticker := time.NewTicker(l.idleTTL)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-l.idleTTL)
+		l.mu.Lock()
+		for ip, entry := range l.limiters {
+			if entry.lastSeen.Before(cutoff) {
+				delete(l.limiters, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// rateLimitMiddleware rejects requests over the configured per-IP rate with
+// 429 Too Many Requests and a Retry-After hint.
+func rateLimitMiddleware(limiter *ipRateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.allow(getRealIP(r)) {
+			retryAfter := time.Second
+			if limiter.rps > 0 {
+				retryAfter = time.Duration(float64(time.Second) / float64(limiter.rps))
+			}
+			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", retryAfter.Seconds()))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// ReplayStore records solved ALTCHA payloads so they can't be verified more
+// than once. A single-process cache (memoryReplayStore) is fine for one
+// instance, but a load-balanced deployment needs every replica to agree on
+// what's already been used, hence the Redis-backed implementation.
+type ReplayStore interface {
+	// Seen reports whether payload has already been recorded, along with the
+	// expiry time it was recorded with.
+	Seen(payload string) (time.Time, bool)
+	// Record marks payload as used until expiresAt.
+	Record(payload string, expiresAt time.Time) error
+	// Len returns the (possibly approximate) number of entries currently tracked.
+	Len() int64
+}
+
+// newReplayStore builds the ReplayStore selected by REPLAY_STORE
+// ("memory" or "redis"; defaults to "memory").
+func newReplayStore() (ReplayStore, error) {
+	switch backend := getEnv("REPLAY_STORE", "memory"); backend {
+	case "memory":
+		return newMemoryReplayStore()
+	case "redis":
+		return newRedisReplayStore(getEnv("REDIS_URL", "redis://localhost:6379/0"))
+	default:
+		return nil, fmt.Errorf("unknown REPLAY_STORE backend: %s", backend)
+	}
+}
+
+// memoryReplayStore is the original in-process ristretto-backed cache.
+type memoryReplayStore struct {
+	cache *ristretto.Cache[string, time.Time]
+	count int64
+}
+
+func newMemoryReplayStore() (*memoryReplayStore, error) {
+	store := &memoryReplayStore{}
+	cache, err := ristretto.NewCache(&ristretto.Config[string, time.Time]{
+		NumCounters: 1e6,     // number of keys to track frequency of (1M)
+		MaxCost:     1 << 30, // maximum cost of cache (1GB)
+		BufferItems: 64,      // number of keys per Get buffer
+		OnEvict: func(item *ristretto.Item[time.Time]) {
+			atomic.AddInt64(&store.count, -1)
+			replayCacheEvictionsTotal.Inc()
+			logger.Info("evicted from replay cache", "key", item.Key)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Ristretto cache: %w", err)
+	}
+	store.cache = cache
+	return store, nil
+}
+
+func (s *memoryReplayStore) Seen(payload string) (time.Time, bool) {
+	return s.cache.Get(payload)
+}
+
+func (s *memoryReplayStore) Record(payload string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	s.cache.SetWithTTL(payload, expiresAt, int64(1), ttl)
+	atomic.AddInt64(&s.count, 1)
+	return nil
+}
+
+func (s *memoryReplayStore) Len() int64 {
+	return atomic.LoadInt64(&s.count)
+}
+
+func (s *memoryReplayStore) Close() error {
+	s.cache.Close()
+	return nil
+}
+
+// redisReplayStore uses SET NX PX so that, regardless of which altcha-lite
+// replica a solved challenge is submitted to, only the first one wins.
+type redisReplayStore struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+const redisReplayKeyPrefix = "altcha:replay:"
+
+func newRedisReplayStore(redisURL string) (*redisReplayStore, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return &redisReplayStore{client: client, ctx: ctx}, nil
+}
+
+func (s *redisReplayStore) key(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+	return redisReplayKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// Seen treats redis.Nil (key genuinely not present) as "not seen", but any
+// other error (connection failure, timeout, Redis outage) is logged and
+// counted separately via replayStoreErrorsTotal so an operator can tell a
+// real outage from legitimately-unseen payloads, rather than both silently
+// looking like "not seen".
+func (s *redisReplayStore) Seen(payload string) (time.Time, bool) {
+	val, err := s.client.Get(s.ctx, s.key(payload)).Result()
+	if err != nil {
+		if err != redis.Nil {
+			replayStoreErrorsTotal.WithLabelValues("seen").Inc()
+			logger.Error("replay store lookup failed", "error", err)
+		}
+		return time.Time{}, false
+	}
+	unixNano, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, unixNano), true
+}
+
+func (s *redisReplayStore) Record(payload string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	ok, err := s.client.SetNX(s.ctx, s.key(payload), expiresAt.UnixNano(), ttl).Result()
+	if err != nil {
+		replayStoreErrorsTotal.WithLabelValues("record").Inc()
+		return fmt.Errorf("failed to record replay key: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("payload already recorded")
+	}
+	return nil
+}
+
+func (s *redisReplayStore) Len() int64 {
+	// DBSIZE is an approximation: it counts every key in the selected
+	// database, not just replay keys, but it's cheap and good enough for
+	// the /health gauge. Use a dedicated Redis DB via REDIS_URL if that
+	// matters for your deployment. Returns -1 if DBSIZE fails.
+	n, err := s.client.DBSize(s.ctx).Result()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func (s *redisReplayStore) Close() error {
+	return s.client.Close()
+}
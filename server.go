@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newHTTPServer builds the http.Server used by main, with all timeouts
+// configurable via env so a deployment can tune them without a rebuild.
+func newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + serverPort,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(getEnvAsInt("READ_HEADER_TIMEOUT_SECONDS", 5)) * time.Second,
+		ReadTimeout:       time.Duration(getEnvAsInt("READ_TIMEOUT_SECONDS", 10)) * time.Second,
+		WriteTimeout:      time.Duration(getEnvAsInt("WRITE_TIMEOUT_SECONDS", 10)) * time.Second,
+		IdleTimeout:       time.Duration(getEnvAsInt("IDLE_TIMEOUT_SECONDS", 120)) * time.Second,
+	}
+}
+
+// serve starts srv, choosing plain HTTP, static-cert TLS, or autocert-backed
+// TLS based on which env vars are set:
+//   - ACME_DOMAINS set: serve TLS via Let's Encrypt, using ACME_CACHE_DIR to
+//     persist issued certificates across restarts.
+//   - TLS_CERT_FILE and TLS_KEY_FILE set: serve TLS from a static cert/key pair.
+//   - neither set: serve plain HTTP, as before.
+//
+// It blocks until the server stops, returning http.ErrServerClosed on a
+// graceful shutdown.
+func serve(srv *http.Server) error {
+	if acmeDomains := getEnv("ACME_DOMAINS", ""); acmeDomains != "" {
+		certManager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(acmeDomains, ",")...),
+			Cache:      autocert.DirCache(getEnv("ACME_CACHE_DIR", "./acme-cache")),
+		}
+		srv.TLSConfig = certManager.TLSConfig()
+
+		go func() {
+			// ACME HTTP-01 challenges must be served on plain :80.
+			if err := http.ListenAndServe(":http", certManager.HTTPHandler(nil)); err != nil {
+				logger.Error("acme http-01 challenge listener failed", "error", err)
+			}
+		}()
+
+		return srv.ListenAndServeTLS("", "")
+	}
+
+	certFile, keyFile := getEnv("TLS_CERT_FILE", ""), getEnv("TLS_KEY_FILE", "")
+	if certFile != "" && keyFile != "" {
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	}
+
+	return srv.ListenAndServe()
+}
+
+// waitForShutdown blocks until SIGINT/SIGTERM, then drains in-flight
+// requests and releases resources that hold open connections or timers.
+func waitForShutdown(srv *http.Server) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	logger.Info("shutdown signal received, draining in-flight requests")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(getEnvAsInt("SHUTDOWN_TIMEOUT_SECONDS", 15))*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("graceful shutdown failed", "error", err)
+	}
+
+	if closer, ok := usedSolutions.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Error("failed to close replay store", "error", err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/altcha-org/altcha-lib-go"
+)
+
+// spamFilterResult is the JSON response returned to callers of
+// /verify-spam-filter so they can decide what to do with the classification.
+type spamFilterResult struct {
+	Success        bool     `json:"success"`
+	Verified       bool     `json:"verified"`
+	Classification string   `json:"classification,omitempty"`
+	Score          float64  `json:"score,omitempty"`
+	Reasons        []string `json:"reasons,omitempty"`
+	FieldsVerified *bool    `json:"fieldsVerified,omitempty"`
+	Message        string   `json:"message,omitempty"`
+}
+
+// verifySpamFilterHandler verifies ALTCHA's server-signed "spam filter"
+// payloads, as opposed to the standard proof-of-work solutions handled by
+// verifyHandler. When the payload carries hashed form-field fingerprints it
+// also checks those against the values actually submitted and reports the
+// outcome as fieldsVerified, so a caller can tell a classification obtained
+// for different form data. A fields mismatch does not change verified or
+// success; the payload is still recorded for replay detection.
+func verifySpamFilterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload := r.FormValue("altcha")
+	if payload == "" {
+		http.Error(w, "Altcha payload missing", http.StatusBadRequest)
+		return
+	}
+
+	requestID := requestIDFromContext(r.Context())
+
+	if replayDetectionEnabled && usedSolutions != nil {
+		if expiresAt, found := usedSolutions.Seen(payload); found {
+			if time.Now().Before(expiresAt) {
+				logger.Warn("spam filter verification rejected", "requestId", requestID, "outcome", "replay", "replayHit", true)
+				writeError(w, "Replay detected: CAPTCHA already used")
+				return
+			}
+		}
+	}
+
+	verified, verificationData, err := altcha.VerifyServerSignature(payload, altchaHMACKey)
+	if err != nil {
+		logger.Error("spam filter verification error", "requestId", requestID, "outcome", "error", "error", err)
+		writeError(w, "Verification error: "+err.Error())
+		return
+	}
+	if !verified {
+		writeJSON(w, spamFilterResult{Success: true, Verified: false, Message: "Signature verification failed"})
+		return
+	}
+
+	result := spamFilterResult{
+		Success:        true,
+		Verified:       true,
+		Classification: verificationData.Classification,
+		Score:          verificationData.Score,
+		Reasons:        verificationData.Reasons,
+	}
+
+	if verificationData.FieldsHash != "" {
+		fieldsOK, err := altcha.VerifyFieldsHash(r.Form, verificationData.Fields, verificationData.FieldsHash, "SHA-256")
+		if err != nil {
+			logger.Error("spam filter fields hash verification error", "requestId", requestID, "error", err)
+			writeError(w, "Fields verification error: "+err.Error())
+			return
+		}
+		result.FieldsVerified = &fieldsOK
+	}
+
+	if replayDetectionEnabled && usedSolutions != nil {
+		expiresAt := time.Now().Add(time.Duration(expireTimeInMins) * time.Minute)
+		if err := usedSolutions.Record(payload, expiresAt); err != nil {
+			logger.Error("failed to record spam filter payload in replay store", "requestId", requestID, "error", err)
+		}
+	}
+
+	logger.Info("spam filter verification succeeded", "requestId", requestID, "outcome", "success", "classification", result.Classification)
+	writeJSON(w, result)
+}